@@ -0,0 +1,143 @@
+package graphite
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format selects the wire format used to serialize a flush's samples.
+type Format int
+
+const (
+	// FormatPlaintext is the Graphite carbon-cache plaintext protocol:
+	// one "<path> <value> <timestamp>\n" line per sample. It's the
+	// default when Config.Format is left unset.
+	FormatPlaintext Format = iota
+	// FormatPickle is the Graphite carbon pickle protocol: a
+	// length-prefixed, batched pickle payload of (metric, (timestamp,
+	// value)) tuples, suited to a carbon-cache's pickle receiver or
+	// carbon-relay-ng.
+	FormatPickle
+	// FormatOpenTSDB is the OpenTSDB telnet put-line format:
+	// "put <metric> <timestamp> <value> <tagk1>=<tagv1> ...".
+	FormatOpenTSDB
+)
+
+// sample is the formatter-agnostic representation of a single emitted
+// data point. render walks the Registry into samples; a formatter turns
+// them into the bytes written to the transport.
+type sample struct {
+	name  string
+	tags  map[string]string
+	value float64
+	ts    int64
+}
+
+// formatter serializes one flush's samples into w.
+type formatter interface {
+	format(w *bytes.Buffer, samples []sample)
+}
+
+// formatterFor returns the formatter for f, defaulting to plaintext for
+// the zero value and any other unrecognized Format.
+func formatterFor(f Format) formatter {
+	switch f {
+	case FormatPickle:
+		return pickleFormatter{}
+	case FormatOpenTSDB:
+		return openTSDBFormatter{}
+	default:
+		return plaintextFormatter{}
+	}
+}
+
+// plaintextFormatter serializes samples in Graphite's plaintext
+// protocol, encoding tags with the semicolon convention documented at
+// https://graphite.readthedocs.io/en/latest/tags.html.
+type plaintextFormatter struct{}
+
+func (plaintextFormatter) format(w *bytes.Buffer, samples []sample) {
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s %d\n", s.name, tagSuffix(s.tags), formatValue(s.value), s.ts)
+	}
+}
+
+// openTSDBFormatter serializes samples in the OpenTSDB telnet put-line
+// format, carrying tags as native OpenTSDB tagk=tagv pairs.
+type openTSDBFormatter struct{}
+
+func (openTSDBFormatter) format(w *bytes.Buffer, samples []sample) {
+	for _, s := range samples {
+		fmt.Fprintf(w, "put %s %d %s", s.name, s.ts, formatValue(s.value))
+		for _, k := range sortedTagKeys(s.tags) {
+			fmt.Fprintf(w, " %s=%s", k, s.tags[k])
+		}
+		w.WriteByte('\n')
+	}
+}
+
+// tagSuffix renders tags as a sorted ";k=v" suffix, or "" when tags is
+// empty.
+func tagSuffix(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, k := range sortedTagKeys(tags) {
+		b.WriteByte(';')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
+
+// sortedTagKeys returns tags' keys in sorted order, for deterministic
+// serialization.
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergeTags layers tags over defaults, without letting defaults
+// override a key tags already sets. Returns tags unmodified when
+// defaults is empty, so callers can skip allocating in the common case.
+func mergeTags(defaults, tags map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return tags
+	}
+	merged := make(map[string]string, len(defaults)+len(tags))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// encodeTags appends tags to name using Graphite's semicolon tag
+// convention, e.g. encodeTags("disk.used", map[string]string{"dc":
+// "dc1"}) returns "disk.used;dc=dc1".
+func encodeTags(name string, tags map[string]string) string {
+	return name + tagSuffix(tags)
+}
+
+// formatValue renders v using the shortest exact decimal representation.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// round2 rounds v to 2 decimal places, matching the %.2f precision the
+// plaintext exporter has always used for means, rates and percentiles.
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,30 @@
+package graphite
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOpenTSDBFormatterFormat(t *testing.T) {
+	samples := []sample{
+		{name: "app.reqs.count", tags: map[string]string{"region": "us", "env": "prod"}, value: 5, ts: 1000},
+		{name: "app.reqs.mean", tags: nil, value: 1.25, ts: 1000},
+	}
+
+	var buf bytes.Buffer
+	openTSDBFormatter{}.format(&buf, samples)
+
+	want := "put app.reqs.count 1000 5 env=prod region=us\n" +
+		"put app.reqs.mean 1000 1.25\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestOpenTSDBFormatterNoSamples(t *testing.T) {
+	var buf bytes.Buffer
+	openTSDBFormatter{}.format(&buf, nil)
+	if buf.Len() != 0 {
+		t.Fatalf("expected no output for no samples, got %q", buf.String())
+	}
+}
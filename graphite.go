@@ -1,8 +1,8 @@
 package graphite
 
 import (
-	"bufio"
-	"fmt"
+	"bytes"
+	"context"
 	"log"
 	"net"
 	"strconv"
@@ -21,8 +21,50 @@ type Config struct {
 	DurationUnit  time.Duration    // Time conversion unit for durations
 	Prefix        string           // Prefix to be prepended to metric names
 	Percentiles   []float64        // Percentiles to export from timers and histograms
+
+	// Transport delivers each flush's payload to the Graphite server. It
+	// defaults to a TCPTransport dialing Addr when nil.
+	Transport Transport
+	// MaxBacklog caps the number of flushes buffered in memory while the
+	// transport is unavailable. The oldest payload is dropped first once
+	// the backlog is full. Defaults to 10.
+	MaxBacklog int
+
+	// EmitResettingTimers enables emitting reset-window timer values
+	// (.count, .mean, .50-percentile, .95-percentile, .99-percentile)
+	// instead of silently ignoring them. See resettingTimer.
+	EmitResettingTimers bool
+
+	// Format selects the wire format samples are serialized with.
+	// Defaults to FormatPlaintext.
+	Format Format
+
+	// DefaultTags are appended to every emitted sample, e.g. {"host":
+	// os.Hostname(), "dc": "us-east"}. A per-metric tag of the same key
+	// (set via splitNameAndTags or TaggedRegistry) always wins.
+	DefaultTags map[string]string
 }
 
+// resettingTimer is the subset of methods go-metrics forks (e.g.
+// github.com/ethersphere/go-metrics) add to support reset-window
+// timers, which rcrowley/go-metrics itself has no notion of. It's
+// declared locally, rather than imported from such a fork, so this
+// package can keep depending on the canonical rcrowley/go-metrics
+// module for every other metric type; any fork's concrete
+// ResettingTimer type satisfies it structurally, without a hard
+// dependency on that fork's import path.
+type resettingTimer interface {
+	Values() []int64
+	Percentiles([]float64) []int64
+	Mean() float64
+}
+
+// resettingTimerPercentiles are the percentiles emitted for
+// resettingTimer values, matching the latency SLO dashboards they're
+// meant to feed. Unlike c.Percentiles, resettingTimer.Percentiles
+// takes its percentiles on a 0-100 scale rather than as 0-1 fractions.
+var resettingTimerPercentiles = []float64{50, 95, 99}
+
 // Graphite is a blocking exporter function which reports metrics in r
 // to a graphite server located at addr, flushing them every d duration
 // and prepending metric names with prefix.
@@ -37,13 +79,19 @@ func Graphite(r metrics.Registry, d time.Duration, prefix string, addr *net.TCPA
 	})
 }
 
-// WithConfig is a blocking exporter function just like Graphite,
-// but it takes a GraphiteConfig instead.
+// WithConfig is a blocking exporter function just like Graphite, but it
+// takes a Config instead. It's a thin wrapper around Reporter for
+// callers that don't need to shut down cleanly; use NewReporter and
+// Start/Stop directly for that.
 func WithConfig(c Config) {
-	for _ = range time.Tick(c.FlushInterval) {
-		if err := graphite(&c); nil != err {
-			log.Println(err)
-		}
+	r := NewReporter(c)
+	defer r.Close()
+	if err := r.Start(context.Background()); nil != err {
+		log.Println(err)
+		return
+	}
+	for err := range r.Errors() {
+		log.Println(err)
 	}
 }
 
@@ -51,89 +99,106 @@ func WithConfig(c Config) {
 // non-nil error on failed connections. This can be used in a loop
 // similar to GraphiteWithConfig for custom error handling.
 func Once(c Config) error {
-	return graphite(&c)
+	r := NewReporter(c)
+	defer r.Close()
+	return r.Flush()
 }
 
-func graphite(c *Config) error {
+// render walks the current snapshot of c.Registry into samples and
+// writes them to w using the formatter for c.Format.
+func render(c *Config, w *bytes.Buffer) {
 	now := time.Now().Unix()
 	du := float64(c.DurationUnit)
 	flushSeconds := float64(c.FlushInterval) / float64(time.Second)
-	conn, err := net.DialTCP("tcp", nil, c.Addr)
-	if nil != err {
-		return err
+	var samples []sample
+	emit := func(suffix string, tags map[string]string, value float64) {
+		samples = append(samples, sample{name: c.Prefix + "." + suffix, tags: tags, value: value, ts: now})
+	}
+	percentileSuffix := func(psKey float64) string {
+		return strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1) + "-percentile"
 	}
-	defer conn.Close()
-	w := bufio.NewWriter(conn)
 	c.Registry.Each(func(name string, i interface{}) {
 		name, tags := splitNameAndTags(name)
+		tags = mergeTags(c.DefaultTags, tags)
 		switch metric := i.(type) {
 		case metrics.Counter:
 			count := metric.Count()
-			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, name, tags, count, now)
-			fmt.Fprintf(w, "%s.%s.count_ps%s %.2f %d\n", c.Prefix, name, tags, float64(count)/flushSeconds, now)
+			emit(name+".count", tags, float64(count))
+			emit(name+".count_ps", tags, round2(float64(count)/flushSeconds))
 		case metrics.Gauge:
-			fmt.Fprintf(w, "%s.%s.value%s %d %d\n", c.Prefix, name, tags, metric.Value(), now)
+			emit(name+".value", tags, float64(metric.Value()))
 		case metrics.GaugeFloat64:
-			fmt.Fprintf(w, "%s.%s.value%s %f %d\n", c.Prefix, name, tags, metric.Value(), now)
+			emit(name+".value", tags, metric.Value())
 		case metrics.Histogram:
 			h := metric.Snapshot()
 			ps := h.Percentiles(c.Percentiles)
-			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, name, tags, h.Count(), now)
-			fmt.Fprintf(w, "%s.%s.min%s %d %d\n", c.Prefix, name, tags, h.Min(), now)
-			fmt.Fprintf(w, "%s.%s.max%s %d %d\n", c.Prefix, name, tags, h.Max(), now)
-			fmt.Fprintf(w, "%s.%s.mean%s %.2f %d\n", c.Prefix, name, tags, h.Mean(), now)
-			fmt.Fprintf(w, "%s.%s.std-dev%s %.2f %d\n", c.Prefix, name, tags, h.StdDev(), now)
+			emit(name+".count", tags, float64(h.Count()))
+			emit(name+".min", tags, float64(h.Min()))
+			emit(name+".max", tags, float64(h.Max()))
+			emit(name+".mean", tags, round2(h.Mean()))
+			emit(name+".std-dev", tags, round2(h.StdDev()))
 			for psIdx, psKey := range c.Percentiles {
-				key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-				fmt.Fprintf(w, "%s.%s.%s-percentile%s %.2f %d\n", c.Prefix, name, tags, key, ps[psIdx], now)
+				emit(name+"."+percentileSuffix(psKey), tags, round2(ps[psIdx]))
 			}
 		case metrics.Meter:
 			m := metric.Snapshot()
-			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, name, tags, m.Count(), now)
-			fmt.Fprintf(w, "%s.%s.one-minute%s %.2f %d\n", c.Prefix, name, tags, m.Rate1(), now)
-			fmt.Fprintf(w, "%s.%s.five-minute%s %.2f %d\n", c.Prefix, name, tags, m.Rate5(), now)
-			fmt.Fprintf(w, "%s.%s.fifteen-minute%s %.2f %d\n", c.Prefix, name, tags, m.Rate15(), now)
-			fmt.Fprintf(w, "%s.%s.mean%s %.2f %d\n", c.Prefix, name, tags, m.RateMean(), now)
+			emit(name+".count", tags, float64(m.Count()))
+			emit(name+".one-minute", tags, round2(m.Rate1()))
+			emit(name+".five-minute", tags, round2(m.Rate5()))
+			emit(name+".fifteen-minute", tags, round2(m.Rate15()))
+			emit(name+".mean", tags, round2(m.RateMean()))
 		case metrics.Timer:
 			t := metric.Snapshot()
 			ps := t.Percentiles(c.Percentiles)
 			count := t.Count()
-			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, name, tags, count, now)
-			fmt.Fprintf(w, "%s.%s.count_ps%s %.2f %d\n", c.Prefix, name, tags, float64(count)/flushSeconds, now)
-			fmt.Fprintf(w, "%s.%s.min%s %d %d\n", c.Prefix, name, tags, t.Min()/int64(du), now)
-			fmt.Fprintf(w, "%s.%s.max%s %d %d\n", c.Prefix, name, tags, t.Max()/int64(du), now)
-			fmt.Fprintf(w, "%s.%s.mean%s %.2f %d\n", c.Prefix, name, tags, t.Mean()/du, now)
-			fmt.Fprintf(w, "%s.%s.std-dev%s %.2f %d\n", c.Prefix, name, tags, t.StdDev()/du, now)
+			emit(name+".count", tags, float64(count))
+			emit(name+".count_ps", tags, round2(float64(count)/flushSeconds))
+			emit(name+".min", tags, float64(t.Min()/int64(du)))
+			emit(name+".max", tags, float64(t.Max()/int64(du)))
+			emit(name+".mean", tags, round2(t.Mean()/du))
+			emit(name+".std-dev", tags, round2(t.StdDev()/du))
 			for psIdx, psKey := range c.Percentiles {
-				key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-				fmt.Fprintf(w, "%s.%s.%s-percentile%s %.2f %d\n", c.Prefix, name, tags, key, ps[psIdx]/du, now)
+				emit(name+"."+percentileSuffix(psKey), tags, round2(ps[psIdx]/du))
+			}
+			emit(name+".one-minute", tags, round2(t.Rate1()))
+			emit(name+".five-minute", tags, round2(t.Rate5()))
+			emit(name+".fifteen-minute", tags, round2(t.Rate15()))
+			emit(name+".mean-rate", tags, round2(t.RateMean()))
+		case resettingTimer:
+			if !c.EmitResettingTimers {
+				break
+			}
+			ps := metric.Percentiles(resettingTimerPercentiles)
+			mean := metric.Mean()
+			count := len(metric.Values())
+			emit(name+".count", tags, float64(count))
+			emit(name+".mean", tags, round2(mean/du))
+			for psIdx, psKey := range resettingTimerPercentiles {
+				emit(name+"."+percentileSuffix(psKey/100.0), tags, round2(float64(ps[psIdx])/du))
 			}
-			fmt.Fprintf(w, "%s.%s.one-minute%s %.2f %d\n", c.Prefix, name, tags, t.Rate1(), now)
-			fmt.Fprintf(w, "%s.%s.five-minute%s %.2f %d\n", c.Prefix, name, tags, t.Rate5(), now)
-			fmt.Fprintf(w, "%s.%s.fifteen-minute%s %.2f %d\n", c.Prefix, name, tags, t.Rate15(), now)
-			fmt.Fprintf(w, "%s.%s.mean-rate%s %.2f %d\n", c.Prefix, name, tags, t.RateMean(), now)
 		default:
 			log.Printf("unable to record metric of type %T\n", i)
 		}
-		w.Flush()
 	})
-	return nil
+	formatterFor(c.Format).format(w, samples)
 }
 
-// the input string name may contain tags
-// e.g given input string name="disk.used;datacenter=dc1;rack=a1;server=web01"
-// will return ("disk.used", "datacenter=dc1;rack=1a;server=web01")
-// name and tags are separated by semicolon ";"
+// splitNameAndTags splits a metric name that may carry tags encoded
+// with Graphite's semicolon convention, e.g.
+// "disk.used;datacenter=dc1;rack=a1" into ("disk.used",
+// {"datacenter": "dc1", "rack": "a1"}).
 // refer to https://graphite.readthedocs.io/en/latest/tags.html
-func splitNameAndTags(name string) (string, string) {
-	if strings.Contains(name, ";") {
-		splitted := strings.SplitN(name, ";", 2)
-		if len(splitted) == 2 {
-			return splitted[0], ";" + splitted[1]
-		} else {
-			return name, ""
+func splitNameAndTags(name string) (string, map[string]string) {
+	if !strings.Contains(name, ";") {
+		return name, nil
+	}
+	parts := strings.Split(name, ";")
+	tags := make(map[string]string, len(parts)-1)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = kv[1]
 		}
-	} else {
-		return name, ""
 	}
+	return parts[0], tags
 }
@@ -0,0 +1,50 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// pickleFormatter serializes samples as a Python pickle (protocol 0)
+// list of (metric, (timestamp, value)) tuples, batched into a single
+// payload prefixed with its 4-byte big-endian length, as expected by a
+// Graphite carbon-cache's pickle receiver.
+type pickleFormatter struct{}
+
+func (pickleFormatter) format(w *bytes.Buffer, samples []sample) {
+	w.Write(picklePayload(samples))
+}
+
+// picklePayload pickles samples into a length-prefixed payload. Each
+// sample's tags are folded into its metric path using the same
+// semicolon convention the plaintext formatter uses, since the pickle
+// protocol has no native notion of tags.
+func picklePayload(samples []sample) []byte {
+	var body bytes.Buffer
+	body.WriteString("(lp0\n")
+	memo := 1
+	for _, s := range samples {
+		path := s.name + tagSuffix(s.tags)
+		fmt.Fprintf(&body, "(S'%s'\np%d\n", pickleEscape(path), memo)
+		memo++
+		fmt.Fprintf(&body, "(I%d\nF%s\ntp%d\n", s.ts, formatValue(s.value), memo)
+		memo++
+		fmt.Fprintf(&body, "tp%d\na", memo)
+		memo++
+	}
+	body.WriteString(".")
+
+	payload := make([]byte, 4, 4+body.Len())
+	binary.BigEndian.PutUint32(payload, uint32(body.Len()))
+	return append(payload, body.Bytes()...)
+}
+
+// pickleEscape escapes characters that would break out of the
+// single-quoted pickle STRING opcode.
+func pickleEscape(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "'", "\\'")
+	return s
+}
@@ -0,0 +1,104 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodedTuple is one (metric, (timestamp, value)) tuple recovered by
+// decodePicklePayload.
+type decodedTuple struct {
+	name  string
+	ts    int64
+	value float64
+}
+
+// pickleTupleRE matches one "(S'<path>'\np<n>\n(I<ts>\nF<value>\ntp<n>\ntp<n>\na"
+// tuple, i.e. exactly the opcode sequence picklePayload emits per sample.
+var pickleTupleRE = regexp.MustCompile(`\(S'((?:[^'\\]|\\.)*)'\np\d+\n\(I(-?\d+)\nF([^\n]+)\ntp\d+\ntp\d+\na`)
+
+// decodePicklePayload parses payload back into its (name, timestamp,
+// value) tuples. It understands only the exact opcode sequence
+// picklePayload emits, which is enough to catch a regression in the
+// encoding (wrong opcode, bad memo numbering, broken escaping) without
+// needing a real Python pickle implementation.
+func decodePicklePayload(t *testing.T, payload []byte) []decodedTuple {
+	t.Helper()
+	if len(payload) < 4 {
+		t.Fatalf("payload too short to hold a length prefix: %d bytes", len(payload))
+	}
+	length := binary.BigEndian.Uint32(payload[:4])
+	body := payload[4:]
+	if int(length) != len(body) {
+		t.Fatalf("length prefix %d doesn't match body length %d", length, len(body))
+	}
+	if !bytes.HasPrefix(body, []byte("(lp0\n")) {
+		t.Fatalf("missing list-open opcode, body starts with %q", body)
+	}
+	if !bytes.HasSuffix(body, []byte(".")) {
+		t.Fatalf("missing trailing STOP opcode, body ends with %q", body)
+	}
+
+	var tuples []decodedTuple
+	for _, m := range pickleTupleRE.FindAllSubmatch(body, -1) {
+		ts, err := strconv.ParseInt(string(m[2]), 10, 64)
+		if err != nil {
+			t.Fatalf("bad timestamp %q: %v", m[2], err)
+		}
+		value, err := strconv.ParseFloat(string(m[3]), 64)
+		if err != nil {
+			t.Fatalf("bad value %q: %v", m[3], err)
+		}
+		tuples = append(tuples, decodedTuple{
+			name:  pickleUnescape(string(m[1])),
+			ts:    ts,
+			value: value,
+		})
+	}
+	return tuples
+}
+
+// pickleUnescape reverses pickleEscape.
+func pickleUnescape(s string) string {
+	s = strings.ReplaceAll(s, `\'`, `'`)
+	s = strings.ReplaceAll(s, `\\`, `\`)
+	return s
+}
+
+func TestPickleFormatterRoundTrip(t *testing.T) {
+	samples := []sample{
+		{name: "app.reqs.count", tags: map[string]string{"region": "us"}, value: 5, ts: 1000},
+		{name: "app.o'clock", tags: nil, value: 1.5, ts: 1001},
+	}
+
+	var buf bytes.Buffer
+	pickleFormatter{}.format(&buf, samples)
+
+	got := decodePicklePayload(t, buf.Bytes())
+	want := []decodedTuple{
+		{name: "app.reqs.count;region=us", ts: 1000, value: 5},
+		{name: "app.o'clock", ts: 1001, value: 1.5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d tuples, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Fatalf("tuple %d: got %+v, want %+v", i, got[i], w)
+		}
+	}
+}
+
+func TestPickleFormatterNoSamples(t *testing.T) {
+	var buf bytes.Buffer
+	pickleFormatter{}.format(&buf, nil)
+
+	got := decodePicklePayload(t, buf.Bytes())
+	if len(got) != 0 {
+		t.Fatalf("expected no tuples for no samples, got %+v", got)
+	}
+}
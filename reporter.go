@@ -0,0 +1,283 @@
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	// defaultMaxBacklog is how many flushes' worth of payloads are kept
+	// in memory while the transport is unavailable.
+	defaultMaxBacklog = 10
+
+	minReconnectBackoff = 500 * time.Millisecond
+	maxReconnectBackoff = 30 * time.Second
+	maxDialAttempts     = 5
+
+	// errBacklog is how many background-flush errors Errors() buffers
+	// before new ones are dropped.
+	errBacklog = 16
+)
+
+// Reporter owns a persistent connection to a Graphite server and
+// delivers flush payloads to it. It reconnects with exponential backoff
+// when the connection is lost, and buffers payloads in memory while
+// it's down rather than dropping them, up to MaxBacklog flushes' worth,
+// beyond which the oldest payload is dropped and graphite.backlog.dropped
+// is incremented.
+//
+// A Reporter can be driven directly with Flush, or handed to Start to
+// run a background flush loop until Stop or context cancellation.
+type Reporter struct {
+	Config
+
+	mu      sync.Mutex
+	conn    net.Conn
+	backlog [][]byte
+	dropped metrics.Counter
+
+	// dialMu serializes dialing a new connection, so concurrent
+	// Flush calls that both see conn == nil don't each independently
+	// dial and leak all but one of the resulting connections; losers
+	// wait here and then reuse the winner's connection.
+	dialMu sync.Mutex
+
+	errCh  chan error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReporter builds a Reporter for c, defaulting Transport to a
+// TCPTransport dialing c.Addr and MaxBacklog to defaultMaxBacklog when
+// unset.
+func NewReporter(c Config) *Reporter {
+	return newReporter(&c)
+}
+
+func newReporter(c *Config) *Reporter {
+	r := &Reporter{Config: *c, errCh: make(chan error, errBacklog)}
+	if r.Transport == nil {
+		r.Transport = &TCPTransport{Addr: c.Addr}
+	}
+	if r.MaxBacklog == 0 {
+		r.MaxBacklog = defaultMaxBacklog
+	}
+	if r.Registry != nil {
+		r.dropped = metrics.GetOrRegisterCounter("graphite.backlog.dropped", r.Registry)
+	}
+	return r
+}
+
+// Start begins a background loop that calls Flush every FlushInterval
+// until ctx is done or Stop is called. It returns immediately; errors
+// from individual flushes are sent on Errors rather than returned.
+// Start must not be called again until a prior Start has been Stopped.
+func (r *Reporter) Start(ctx context.Context) error {
+	r.mu.Lock()
+	if r.cancel != nil {
+		r.mu.Unlock()
+		return errors.New("graphite: reporter already started")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	done := r.done
+	r.mu.Unlock()
+
+	go r.run(ctx, done)
+	return nil
+}
+
+func (r *Reporter) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(r.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.flushCtx(ctx); err != nil {
+				select {
+				case r.errCh <- err:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Stop ends the loop started by Start, waits for it to exit, forces one
+// last Flush so nothing buffered is lost, and closes the underlying
+// connection.
+func (r *Reporter) Stop() error {
+	r.mu.Lock()
+	cancel := r.cancel
+	done := r.done
+	r.cancel = nil
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	flushErr := r.Flush()
+	closeErr := r.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// Errors returns the channel background flush errors from Start's loop
+// are sent on. Errors are dropped rather than blocking the loop if this
+// channel isn't drained.
+func (r *Reporter) Errors() <-chan error {
+	return r.errCh
+}
+
+// Close releases the underlying connection, if any.
+func (r *Reporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeLocked()
+}
+
+func (r *Reporter) closeLocked() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// Flush renders the current snapshot of r.Registry and delivers it,
+// outside of Start's background schedule.
+func (r *Reporter) Flush() error {
+	return r.flushCtx(context.Background())
+}
+
+func (r *Reporter) flushCtx(ctx context.Context) error {
+	var buf bytes.Buffer
+	render(&r.Config, &buf)
+	return r.write(ctx, buf.Bytes())
+}
+
+// write appends payload to the backlog, trimming it down to MaxBacklog
+// by dropping the oldest entries, then drains the backlog over the
+// persistent connection. Network I/O, including reconnect backoff,
+// happens without r.mu held so a slow or down backend doesn't block
+// concurrent Flush/Stop/Close calls from touching the backlog; ctx
+// bounds how long a reconnect attempt is retried. Concurrent callers
+// that all need a new connection still serialize on dialMu (see
+// ensureConn) so only one of them actually dials.
+func (r *Reporter) write(ctx context.Context, payload []byte) error {
+	r.mu.Lock()
+	r.backlog = append(r.backlog, payload)
+	for len(r.backlog) > r.MaxBacklog {
+		r.backlog = r.backlog[1:]
+		if r.dropped != nil {
+			r.dropped.Inc(1)
+		}
+	}
+	r.mu.Unlock()
+
+	return r.drain(ctx)
+}
+
+// drain sends every backlogged payload over the persistent connection,
+// (re)dialing as needed, until the backlog is empty or a dial fails.
+func (r *Reporter) drain(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		if len(r.backlog) == 0 {
+			r.mu.Unlock()
+			return nil
+		}
+		conn := r.conn
+		payload := r.backlog[0]
+		r.mu.Unlock()
+
+		if conn == nil {
+			dialed, err := r.ensureConn(ctx)
+			if err != nil {
+				return err
+			}
+			conn = dialed
+		}
+
+		if _, err := conn.Write(payload); err != nil {
+			r.mu.Lock()
+			if r.conn == conn {
+				r.closeLocked()
+			}
+			r.mu.Unlock()
+			continue
+		}
+
+		r.mu.Lock()
+		if len(r.backlog) > 0 {
+			r.backlog = r.backlog[1:]
+		}
+		r.mu.Unlock()
+	}
+}
+
+// ensureConn returns r.conn, dialing a new one if it's nil. Dialing
+// itself happens under dialMu rather than r.mu: concurrent callers
+// block on dialMu instead of each independently dialing, and a caller
+// that was waiting re-checks r.conn once it acquires dialMu, so it
+// reuses whatever connection the winner just established instead of
+// dialing a second one.
+func (r *Reporter) ensureConn(ctx context.Context) (net.Conn, error) {
+	r.dialMu.Lock()
+	defer r.dialMu.Unlock()
+
+	r.mu.Lock()
+	conn := r.conn
+	r.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+
+	dialed, err := r.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.conn = dialed
+	r.mu.Unlock()
+	return dialed, nil
+}
+
+// dial retries Transport.Dial with exponential backoff, giving up and
+// returning ctx's error if ctx is done first, or the last dial error
+// after maxDialAttempts.
+func (r *Reporter) dial(ctx context.Context) (net.Conn, error) {
+	backoff := minReconnectBackoff
+	var lastErr error
+	for attempt := 0; attempt < maxDialAttempts; attempt++ {
+		conn, err := r.Transport.Dial()
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+	return nil, lastErr
+}
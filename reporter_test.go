@@ -0,0 +1,193 @@
+package graphite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// fakeConn is a minimal net.Conn that records writes and can be closed,
+// used to verify Reporter's delivery and reconnect behavior without a
+// real socket.
+type fakeConn struct {
+	mu      sync.Mutex
+	written [][]byte
+	closed  bool
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, errors.New("fakeConn: write on closed connection")
+	}
+	c.written = append(c.written, append([]byte(nil), p...))
+	return len(p), nil
+}
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+func (c *fakeConn) Read([]byte) (int, error)         { return 0, errors.New("fakeConn: read unsupported") }
+func (c *fakeConn) LocalAddr() net.Addr              { return fakeAddr{} }
+func (c *fakeConn) RemoteAddr() net.Addr             { return fakeAddr{} }
+func (c *fakeConn) SetDeadline(time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(time.Time) error { return nil }
+
+type fakeAddr struct{}
+
+func (fakeAddr) Network() string { return "fake" }
+func (fakeAddr) String() string  { return "fake" }
+
+// flakyTransport fails the first failUntil Dial calls, then succeeds
+// and hands out a single fakeConn for the rest of its life.
+type flakyTransport struct {
+	mu        sync.Mutex
+	failUntil int
+	attempts  int
+	conn      *fakeConn
+}
+
+func (t *flakyTransport) Dial() (net.Conn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.attempts++
+	if t.attempts <= t.failUntil {
+		return nil, fmt.Errorf("flakyTransport: dial failure %d", t.attempts)
+	}
+	if t.conn == nil {
+		t.conn = &fakeConn{}
+	}
+	return t.conn, nil
+}
+
+// alwaysFailTransport never manages to dial, used to exercise backlog
+// overflow without ever draining it.
+type alwaysFailTransport struct{}
+
+func (alwaysFailTransport) Dial() (net.Conn, error) {
+	return nil, errors.New("alwaysFailTransport: dial always fails")
+}
+
+// countingTransport counts Dial calls and sleeps before returning, to
+// widen the window in which concurrent callers could race to dial.
+type countingTransport struct {
+	mu    sync.Mutex
+	calls int
+	conn  *fakeConn
+}
+
+func (t *countingTransport) Dial() (net.Conn, error) {
+	t.mu.Lock()
+	t.calls++
+	t.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		t.conn = &fakeConn{}
+	}
+	return t.conn, nil
+}
+
+func TestReporterReconnectsAfterTransientDialFailures(t *testing.T) {
+	ft := &flakyTransport{failUntil: 1}
+	r := newReporter(&Config{
+		Registry:      metrics.NewRegistry(),
+		FlushInterval: time.Second,
+		Prefix:        "app",
+		Transport:     ft,
+	})
+	defer r.Close()
+
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush failed after transient dial failures: %v", err)
+	}
+	if ft.attempts < 2 {
+		t.Fatalf("expected at least 2 dial attempts (1 failure + 1 success), got %d", ft.attempts)
+	}
+	if ft.conn == nil || len(ft.conn.written) == 0 {
+		t.Fatalf("expected the flush payload to reach the connection once dial succeeded")
+	}
+}
+
+func TestReporterBacklogOverflowDropsOldest(t *testing.T) {
+	reg := metrics.NewRegistry()
+	r := newReporter(&Config{
+		Registry:      reg,
+		FlushInterval: time.Second,
+		Prefix:        "app",
+		Transport:     alwaysFailTransport{},
+		MaxBacklog:    2,
+	})
+	defer r.Close()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_ = r.write(ctx, []byte(fmt.Sprintf("payload-%d\n", i)))
+		cancel()
+	}
+
+	r.mu.Lock()
+	backlog := append([][]byte(nil), r.backlog...)
+	r.mu.Unlock()
+
+	if len(backlog) != 2 {
+		t.Fatalf("expected backlog trimmed to MaxBacklog=2, got %d entries: %q", len(backlog), backlog)
+	}
+	if string(backlog[0]) != "payload-1\n" {
+		t.Fatalf("expected oldest payload (payload-0) to be dropped, backlog head is %q", backlog[0])
+	}
+
+	dropped := metrics.GetOrRegisterCounter("graphite.backlog.dropped", reg)
+	if dropped.Count() != 1 {
+		t.Fatalf("expected graphite.backlog.dropped to be 1, got %d", dropped.Count())
+	}
+}
+
+func TestReporterConcurrentFlushesShareOneConnection(t *testing.T) {
+	ct := &countingTransport{}
+	r := newReporter(&Config{
+		Registry:      metrics.NewRegistry(),
+		FlushInterval: time.Second,
+		Prefix:        "app",
+		Transport:     ct,
+	})
+	defer r.Close()
+
+	const flushes = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, flushes)
+	for i := 0; i < flushes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- r.Flush()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+
+	ct.mu.Lock()
+	calls := ct.calls
+	ct.mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("expected exactly 1 Dial call across %d concurrent Flushes, got %d", flushes, calls)
+	}
+}
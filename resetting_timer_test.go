@@ -0,0 +1,143 @@
+package graphite
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// fakeResettingTimer is a minimal stand-in for the ResettingTimer type
+// added by go-metrics forks such as github.com/ethersphere/go-metrics.
+// It satisfies the local resettingTimer interface structurally, the
+// same way a real fork's concrete type would, without this package
+// depending on that fork's import path.
+type fakeResettingTimer struct {
+	values []int64
+}
+
+func (f *fakeResettingTimer) update(d time.Duration) {
+	f.values = append(f.values, int64(d))
+}
+
+func (f *fakeResettingTimer) Mean() float64 {
+	if len(f.values) == 0 {
+		return 0
+	}
+	var sum int64
+	for _, v := range f.values {
+		sum += v
+	}
+	return float64(sum) / float64(len(f.values))
+}
+
+func (f *fakeResettingTimer) Percentiles(ps []float64) []int64 {
+	sorted := append([]int64(nil), f.values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	out := make([]int64, len(ps))
+	if len(sorted) == 0 {
+		return out
+	}
+	for i, p := range ps {
+		idx := int(p / 100 * float64(len(sorted)))
+		if idx >= len(sorted) {
+			idx = len(sorted) - 1
+		}
+		out[i] = sorted[idx]
+	}
+	return out
+}
+
+// Values returns the samples recorded since the last call and clears
+// them, mirroring a real reset-window timer. render calls it last so
+// Mean and Percentiles still see the full window for this flush.
+func (f *fakeResettingTimer) Values() []int64 {
+	v := f.values
+	f.values = nil
+	return v
+}
+
+// resettingTimerRegistry wraps a metrics.Registry so it can also hold
+// reset-window timers: rcrowley/go-metrics' StandardRegistry.Register
+// silently drops metric types it doesn't know, so a timer registered
+// there directly would never reach render.
+type resettingTimerRegistry struct {
+	metrics.Registry
+	timers map[string]resettingTimer
+}
+
+func newResettingTimerRegistry() *resettingTimerRegistry {
+	return &resettingTimerRegistry{Registry: metrics.NewRegistry(), timers: map[string]resettingTimer{}}
+}
+
+func (r *resettingTimerRegistry) Register(name string, i interface{}) error {
+	if rt, ok := i.(resettingTimer); ok {
+		r.timers[name] = rt
+		return nil
+	}
+	return r.Registry.Register(name, i)
+}
+
+func (r *resettingTimerRegistry) Each(f func(string, interface{})) {
+	r.Registry.Each(f)
+	for name, rt := range r.timers {
+		f(name, rt)
+	}
+}
+
+func TestRenderResettingTimerDrainsBuffer(t *testing.T) {
+	r := newResettingTimerRegistry()
+	rt := &fakeResettingTimer{}
+	rt.update(10 * time.Millisecond)
+	rt.update(20 * time.Millisecond)
+	r.Register("latency", rt)
+
+	c := &Config{
+		Registry:            r,
+		FlushInterval:       time.Second,
+		DurationUnit:        time.Millisecond,
+		Prefix:              "test",
+		EmitResettingTimers: true,
+	}
+
+	var buf bytes.Buffer
+	render(c, &buf)
+	if !strings.Contains(buf.String(), "test.latency.count 2") {
+		t.Fatalf("expected count of 2 on first flush, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "test.latency.mean 15") {
+		t.Fatalf("expected mean of 15ms (10ms/20ms averaged, converted from ns), got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "test.latency.95-percentile 20") {
+		t.Fatalf("expected 95th percentile of 20ms, got: %s", buf.String())
+	}
+
+	buf.Reset()
+	render(c, &buf)
+	if !strings.Contains(buf.String(), "test.latency.count 0") {
+		t.Fatalf("expected internal buffer to be drained by the first flush, got: %s", buf.String())
+	}
+}
+
+func TestRenderResettingTimerDisabledByDefault(t *testing.T) {
+	r := newResettingTimerRegistry()
+	rt := &fakeResettingTimer{}
+	rt.update(5 * time.Millisecond)
+	r.Register("latency", rt)
+
+	c := &Config{
+		Registry:      r,
+		FlushInterval: time.Second,
+		DurationUnit:  time.Millisecond,
+		Prefix:        "test",
+	}
+
+	var buf bytes.Buffer
+	render(c, &buf)
+	if strings.Contains(buf.String(), "test.latency") {
+		t.Fatalf("expected ResettingTimer to be skipped when EmitResettingTimers is false, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,34 @@
+package graphite
+
+import "github.com/rcrowley/go-metrics"
+
+// TaggedRegistry wraps a metrics.Registry so metrics can be registered
+// with a structured tags map instead of encoding tags into the metric
+// name string by hand. It encodes tags with the same semicolon
+// convention splitNameAndTags decodes, so metrics registered through it
+// are reported identically to ones registered directly with tags baked
+// into the name.
+type TaggedRegistry struct {
+	metrics.Registry
+}
+
+// NewTaggedRegistry wraps r for structured-tag registration.
+func NewTaggedRegistry(r metrics.Registry) *TaggedRegistry {
+	return &TaggedRegistry{Registry: r}
+}
+
+// Register registers metric under name with tags.
+func (tr *TaggedRegistry) Register(name string, tags map[string]string, metric interface{}) error {
+	return tr.Registry.Register(encodeTags(name, tags), metric)
+}
+
+// GetOrRegister returns the metric already registered under name and
+// tags, registering metric there first if none exists yet.
+func (tr *TaggedRegistry) GetOrRegister(name string, tags map[string]string, metric interface{}) interface{} {
+	return tr.Registry.GetOrRegister(encodeTags(name, tags), metric)
+}
+
+// Unregister removes the metric registered under name and tags.
+func (tr *TaggedRegistry) Unregister(name string, tags map[string]string) {
+	tr.Registry.Unregister(encodeTags(name, tags))
+}
@@ -0,0 +1,59 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// TestMergeTagsPerMetricTagWins protects the precedence mergeTags'
+// doc comment and Config.DefaultTags promise: a default tag must not
+// override a per-metric tag of the same key.
+func TestMergeTagsPerMetricTagWins(t *testing.T) {
+	defaults := map[string]string{"host": "h1", "dc": "us-east"}
+	perMetric := map[string]string{"dc": "us-west", "region": "r1"}
+
+	got := mergeTags(defaults, perMetric)
+
+	want := map[string]string{"host": "h1", "dc": "us-west", "region": "r1"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d tags, want %d: %+v", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("tag %q = %q, want %q (a default must not override a per-metric tag)", k, got[k], v)
+		}
+	}
+}
+
+func TestMergeTagsNoDefaults(t *testing.T) {
+	perMetric := map[string]string{"region": "r1"}
+	got := mergeTags(nil, perMetric)
+	if len(got) != 1 || got["region"] != "r1" {
+		t.Fatalf("expected tags unchanged when there are no defaults, got %+v", got)
+	}
+}
+
+func TestTaggedRegistryRegisterGetOrRegisterUnregister(t *testing.T) {
+	r := metrics.NewRegistry()
+	tr := NewTaggedRegistry(r)
+	tags := map[string]string{"region": "us"}
+
+	c := metrics.NewCounter()
+	if err := tr.Register("reqs", tags, c); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if got := r.Get("reqs;region=us"); got != c {
+		t.Fatalf("expected the underlying registry to hold the metric under \"reqs;region=us\", got %v", got)
+	}
+
+	got := tr.GetOrRegister("reqs", tags, metrics.NewCounter())
+	if got != c {
+		t.Fatalf("GetOrRegister should return the already-registered counter, got a different metric")
+	}
+
+	tr.Unregister("reqs", tags)
+	if got := r.Get("reqs;region=us"); got != nil {
+		t.Fatalf("expected metric to be removed after Unregister, got %v", got)
+	}
+}
@@ -0,0 +1,24 @@
+package graphite
+
+import "net"
+
+// Transport abstracts the network delivery of a flush payload to a
+// Graphite-compatible backend. It lets callers plug in UDP, TLS, or a
+// pickle-protocol transport instead of the default plaintext TCP one.
+type Transport interface {
+	// Dial returns a connection ready for writes. It's called on first
+	// use and again whenever the previous connection breaks; a failed
+	// Dial is retried with exponential backoff, up to 5 attempts.
+	Dial() (net.Conn, error)
+}
+
+// TCPTransport dials a plaintext TCP connection to Addr. It's the
+// default Transport used when Config.Transport is nil.
+type TCPTransport struct {
+	Addr *net.TCPAddr
+}
+
+// Dial implements Transport.
+func (t *TCPTransport) Dial() (net.Conn, error) {
+	return net.DialTCP("tcp", nil, t.Addr)
+}